@@ -0,0 +1,141 @@
+// Copyright (c) 2021 James Bowes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpsig
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// calcDigest computes the legacy instance-digest Digest header value for
+// body, using the id-sha-256 algorithm.
+func calcDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "id-sha-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// verifyDigest reports whether dig, a Digest header value, matches body.
+// Only the id-sha-256 algorithm is supported; unknown algorithms are
+// treated as a mismatch.
+func verifyDigest(body []byte, dig string) bool {
+	name, val, ok := strings.Cut(dig, "=")
+	if !ok || name != "id-sha-256" {
+		return false
+	}
+
+	sum := sha256.Sum256(body)
+	return val == base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// defaultContentDigestAlgs is the Content-Digest algorithm used when
+// WithContentDigest isn't given.
+var defaultContentDigestAlgs = []string{"sha-256"}
+
+// digestBody hashes body with the named RFC 9530 algorithm ("sha-256" or
+// "sha-512"). Unknown algorithms report an error.
+func digestBody(alg string, body []byte) ([]byte, error) {
+	switch alg {
+	case "sha-256":
+		sum := sha256.Sum256(body)
+		return sum[:], nil
+	case "sha-512":
+		sum := sha512.Sum512(body)
+		return sum[:], nil
+	default:
+		return nil, fmt.Errorf("httpsig: unsupported content-digest algorithm %q", alg)
+	}
+}
+
+// calcContentDigest computes the RFC 9530 Content-Digest header value for
+// body, as a Structured Fields Dictionary with one member per alg in algs.
+func calcContentDigest(body []byte, algs ...string) (string, error) {
+	members := make([]string, len(algs))
+	for i, alg := range algs {
+		sum, err := digestBody(alg, body)
+		if err != nil {
+			return "", err
+		}
+		members[i] = alg + "=:" + base64.StdEncoding.EncodeToString(sum) + ":"
+	}
+
+	return strings.Join(members, ", "), nil
+}
+
+// parseDigestDict parses s, a Structured Fields Dictionary (RFC 8941
+// section 3.2) of Byte Sequence members, as used by the Content-Digest
+// header. Per-member parameters, if any, are accepted and ignored.
+func parseDigestDict(s string) (map[string][]byte, error) {
+	out := make(map[string][]byte)
+
+	for _, member := range strings.Split(s, ",") {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			continue
+		}
+
+		name, rest, ok := strings.Cut(member, "=")
+		if !ok {
+			return nil, fmt.Errorf("httpsig: malformed content-digest member %q", member)
+		}
+		name = strings.TrimSpace(name)
+
+		rest = strings.TrimSpace(rest)
+		if !strings.HasPrefix(rest, ":") {
+			return nil, fmt.Errorf("httpsig: malformed content-digest value for %q", name)
+		}
+		rest = rest[1:]
+
+		end := strings.IndexByte(rest, ':')
+		if end < 0 {
+			return nil, fmt.Errorf("httpsig: unterminated content-digest value for %q", name)
+		}
+
+		val, err := base64.StdEncoding.DecodeString(rest[:end])
+		if err != nil {
+			return nil, fmt.Errorf("httpsig: malformed content-digest value for %q: %w", name, err)
+		}
+
+		out[name] = val
+	}
+
+	return out, nil
+}
+
+// verifyContentDigest reports whether dig, a Content-Digest header value,
+// matches body. Every member of dig whose algorithm this package knows how
+// to compute (sha-256, sha-512) is checked, not only the ones in algs, so a
+// corrupted entry can't hide behind an algorithm the verifier didn't happen
+// to configure; algs only narrows which of those checked algorithms are
+// acceptable as proof the digest was verified at all; at least one member
+// of dig must use one of them.
+func verifyContentDigest(body []byte, dig string, algs []string) bool {
+	members, err := parseDigestDict(dig)
+	if err != nil {
+		return false
+	}
+
+	found := false
+	for name, val := range members {
+		sum, err := digestBody(name, body)
+		if err != nil {
+			// An algorithm we don't implement at all; nothing to check it against.
+			continue
+		}
+
+		if !bytes.Equal(val, sum) {
+			return false
+		}
+
+		if sliceHas(algs, name) {
+			found = true
+		}
+	}
+
+	return found
+}
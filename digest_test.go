@@ -0,0 +1,49 @@
+// Copyright (c) 2021 James Bowes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpsig
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestVerifyContentDigestDetectsUnconfiguredAlgorithmMismatch(t *testing.T) {
+	body := []byte("hello world")
+
+	dig, err := calcContentDigest(body, "sha-256")
+	if err != nil {
+		t.Fatalf("calcContentDigest: %v", err)
+	}
+	// A spec-conformant header may carry more than one algorithm. A verifier
+	// only configured for sha-256 must still catch a corrupted sha-512 member.
+	dig += ", sha-512=:" + base64.StdEncoding.EncodeToString(make([]byte, 64)) + ":"
+
+	if verifyContentDigest(body, dig, []string{"sha-256"}) {
+		t.Fatalf("expected verification to fail on corrupted sha-512 member")
+	}
+}
+
+func TestVerifyContentDigestMultipleValidAlgorithms(t *testing.T) {
+	body := []byte("hello world")
+
+	dig, err := calcContentDigest(body, "sha-256", "sha-512")
+	if err != nil {
+		t.Fatalf("calcContentDigest: %v", err)
+	}
+
+	if !verifyContentDigest(body, dig, []string{"sha-256"}) {
+		t.Fatalf("expected verification to succeed when every present algorithm matches")
+	}
+}
+
+func TestContentDigestDisabled(t *testing.T) {
+	// WithContentDigest with no args disables Content-Digest generation and
+	// leaves the header, and the corresponding signature component, out entirely.
+	s := NewSigner(WithHmacSha256("k1", []byte("secret")), WithContentDigest())
+
+	if sliceHas(s.headers, "content-digest") {
+		t.Fatalf("content-digest should not be a signed component when disabled")
+	}
+}
@@ -6,11 +6,15 @@ package httpsig
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/rsa"
 	"errors"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -32,8 +36,9 @@ type Signer struct {
 
 func NewSigner(opts ...signOption) *Signer {
 	s := signer{
-		keys:    make(map[string]sigHolder),
-		nowFunc: time.Now,
+		keys:              make(map[string]sigHolder),
+		nowFunc:           time.Now,
+		contentDigestAlgs: defaultContentDigestAlgs,
 	}
 
 	for _, o := range opts {
@@ -47,7 +52,13 @@ func NewSigner(opts ...signOption) *Signer {
 	// TODO: normalize headers? lowercase & de-dupe
 
 	// specialty components and digest first, for aesthetics
-	for _, comp := range []string{"digest", "@query", "@path", "@method"} {
+	specialty := []string{"digest"}
+	if len(s.contentDigestAlgs) > 0 {
+		specialty = append(specialty, "content-digest")
+	}
+	specialty = append(specialty, "@query", "@path", "@method")
+
+	for _, comp := range specialty {
 		if !sliceHas(s.headers, comp) {
 			s.headers = append([]string{comp}, s.headers...)
 		}
@@ -70,9 +81,17 @@ func (s *Signer) Sign(r *http.Request) error {
 		}
 	}
 
-	// Always set a digest (for now)
+	// Always set the legacy Digest header, and its RFC 9530 replacement
+	// Content-Digest unless WithContentDigest() disabled it.
 	// TODO: we could skip setting digest on an empty body if content-length is included in the sig
 	r.Header.Set("Digest", calcDigest(b.Bytes()))
+	if len(s.signer.contentDigestAlgs) > 0 {
+		dig, err := calcContentDigest(b.Bytes(), s.signer.contentDigestAlgs...)
+		if err != nil {
+			return err
+		}
+		r.Header.Set("Content-Digest", dig)
+	}
 
 	msg := messageFromRequest(r)
 	hdr, err := s.signer.Sign(msg)
@@ -87,6 +106,75 @@ func (s *Signer) Sign(r *http.Request) error {
 	return nil
 }
 
+// SignResponse is the response counterpart to Sign: it signs resp's body
+// digest, headers, and `@status` component, and sets the resulting
+// Signature and Signature-Input headers on resp.
+func (s *Signer) SignResponse(resp *http.Response) error {
+	b := &bytes.Buffer{}
+	if resp.Body != nil {
+		n, err := b.ReadFrom(resp.Body)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if n != 0 {
+			resp.Body = io.NopCloser(bytes.NewReader(b.Bytes()))
+		}
+	}
+
+	resp.Header.Set("Content-Length", strconv.Itoa(b.Len()))
+	resp.Header.Set("Digest", calcDigest(b.Bytes()))
+	if len(s.signer.contentDigestAlgs) > 0 {
+		dig, err := calcContentDigest(b.Bytes(), s.signer.contentDigestAlgs...)
+		if err != nil {
+			return err
+		}
+		resp.Header.Set("Content-Digest", dig)
+	}
+
+	msg := messageFromResponse(resp)
+	hdr, err := s.signer.signItems(msg, responseHeaders(s.headers, len(s.signer.contentDigestAlgs) > 0))
+	if err != nil {
+		return err
+	}
+
+	for k, v := range hdr {
+		resp.Header[k] = v
+	}
+
+	return nil
+}
+
+// responseHeaders swaps a signer's request-oriented specialty components
+// (`@method`, `@path`, `@query`) for the response-oriented one (`@status`),
+// keeping the rest of headers (regular headers, digest) as-is. contentDigest
+// reports whether Content-Digest is enabled, matching whatever SignResponse
+// decided to set (or not) on the response.
+func responseHeaders(headers []string, contentDigest bool) []string {
+	items := make([]string, 0, len(headers))
+	for _, h := range headers {
+		switch h {
+		case "@method", "@path", "@query":
+			continue
+		}
+		items = append(items, h)
+	}
+
+	specialty := []string{"@status", "digest"}
+	if contentDigest {
+		specialty = append(specialty, "content-digest")
+	}
+
+	for _, comp := range specialty {
+		if !sliceHas(items, comp) {
+			items = append([]string{comp}, items...)
+		}
+	}
+
+	return items
+}
+
 type VerifyingKey interface {
 	Verify(data []byte, signature []byte) error
 }
@@ -95,13 +183,51 @@ type VerifyingKeyResolver interface {
 	Resolve(keyID string) VerifyingKey
 }
 
+// SigningKey lets external code (KMS- or HSM-backed keys, or algorithms this package
+// doesn't ship) provide its own signing logic, mirroring VerifyingKey. It's handed the
+// fully canonicalized message and must return a signature over it.
+type SigningKey interface {
+	Sign(data []byte) ([]byte, error)
+	Algorithm() string
+}
+
+// cryptoSignerKey adapts a stdlib crypto.Signer into a SigningKey.
+type cryptoSignerKey struct {
+	signer crypto.Signer
+	hash   crypto.Hash
+	alg    string
+}
+
+// SigningKeyFromCryptoSigner adapts a stdlib crypto.Signer (eg *rsa.PrivateKey,
+// *ecdsa.PrivateKey, or ed25519.PrivateKey) into a SigningKey under alg. hash selects
+// the digest computed over the message before signing; pass crypto.Hash(0) for
+// algorithms, like ed25519, that sign the full message themselves.
+func SigningKeyFromCryptoSigner(signer crypto.Signer, hash crypto.Hash, alg string) SigningKey {
+	return &cryptoSignerKey{signer: signer, hash: hash, alg: alg}
+}
+
+func (k *cryptoSignerKey) Algorithm() string { return k.alg }
+
+func (k *cryptoSignerKey) Sign(data []byte) ([]byte, error) {
+	if k.hash == 0 {
+		return k.signer.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+
+	h := k.hash.New()
+	h.Write(data)
+
+	return k.signer.Sign(rand.Reader, h.Sum(nil), k.hash)
+}
+
 type Verifier struct {
 	*verifier
 }
 
 func NewVerifier(opts ...verifyOption) *Verifier {
 	v := verifier{
-		nowFunc: time.Now,
+		nowFunc:           time.Now,
+		nonceStore:        newMemNonceStore(5 * time.Minute),
+		contentDigestAlgs: defaultContentDigestAlgs,
 	}
 
 	for _, o := range opts {
@@ -131,13 +257,55 @@ func (v *Verifier) Verify(r *http.Request) (keyID string, err error) {
 		}
 	}
 
-	// Check the digest if set. We only support id-sha-256 for now.
+	// Check the digest if set. We only support id-sha-256 for Digest and
+	// sha-256 and sha-512 for Content-Digest, for now.
 	// TODO: option to require this?
 	if dig := r.Header.Get("Digest"); dig != "" {
 		if !verifyDigest(b.Bytes(), dig) {
 			return keyID, errors.New("digest mismatch")
 		}
 	}
+	if dig := r.Header.Get("Content-Digest"); dig != "" && len(v.verifier.contentDigestAlgs) > 0 {
+		if !verifyContentDigest(b.Bytes(), dig, v.verifier.contentDigestAlgs) {
+			return keyID, errors.New("digest mismatch")
+		}
+	}
+	return keyID, nil
+}
+
+// VerifyResponse is the response counterpart to Verify: it checks resp's
+// Signature, Signature-Input, and (if present) Digest and Content-Digest
+// headers.
+func (v *Verifier) VerifyResponse(resp *http.Response) (keyID string, err error) {
+	msg := messageFromResponse(resp)
+	keyID, err = v.verifier.Verify(msg)
+	if err != nil {
+		return keyID, err
+	}
+
+	b := &bytes.Buffer{}
+	if resp.Body != nil {
+		n, err := b.ReadFrom(resp.Body)
+		if err != nil {
+			return keyID, err
+		}
+		resp.Body.Close()
+
+		if n != 0 {
+			resp.Body = io.NopCloser(bytes.NewReader(b.Bytes()))
+		}
+	}
+
+	if dig := resp.Header.Get("Digest"); dig != "" {
+		if !verifyDigest(b.Bytes(), dig) {
+			return keyID, errors.New("digest mismatch")
+		}
+	}
+	if dig := resp.Header.Get("Content-Digest"); dig != "" && len(v.verifier.contentDigestAlgs) > 0 {
+		if !verifyContentDigest(b.Bytes(), dig, v.verifier.contentDigestAlgs) {
+			return keyID, errors.New("digest mismatch")
+		}
+	}
 	return keyID, nil
 }
 
@@ -171,7 +339,8 @@ func (r rt) RoundTrip(req *http.Request) (*http.Response, error) { return r(req)
 //
 // Requests with missing signatures, malformed signature headers, expired signatures, or
 // invalid signatures are rejected with a `400` response. Only one valid signature is required
-// from the known key ids. However, only the first known key id is checked.
+// from the known key ids: signatures under known key ids are tried in turn until one verifies; use
+// WithRequireAllSignatures or WithRequiredKeyIDs to tighten that policy.
 func NewVerifyMiddleware(opts ...verifyOption) func(http.Handler) http.Handler {
 	// TODO: form and multipart support
 	v := NewVerifier(opts...)
@@ -195,6 +364,87 @@ func NewVerifyMiddleware(opts ...verifyOption) func(http.Handler) http.Handler {
 	}
 }
 
+// bufferedResponseWriter captures a handler's response so NewSignResponseMiddleware
+// can sign it before any bytes reach the client.
+type bufferedResponseWriter struct {
+	header     http.Header
+	body       bytes.Buffer
+	statusCode int
+}
+
+func newBufferedResponseWriter() *bufferedResponseWriter {
+	return &bufferedResponseWriter{header: make(http.Header), statusCode: http.StatusOK}
+}
+
+func (w *bufferedResponseWriter) Header() http.Header { return w.header }
+
+func (w *bufferedResponseWriter) Write(p []byte) (int, error) { return w.body.Write(p) }
+
+func (w *bufferedResponseWriter) WriteHeader(statusCode int) { w.statusCode = statusCode }
+
+// NewSignResponseMiddleware returns a configured http server middleware that signs outgoing
+// responses with http message signatures and a body digest, the response counterpart to
+// NewVerifyMiddleware.
+//
+// Use the various `WithSign*` option funcs to configure signature algorithms with their provided
+// key ids, same as NewSignTransport. The response is buffered so the digest and Content-Length
+// can be computed before headers are flushed to the client.
+func NewSignResponseMiddleware(opts ...signOption) func(http.Handler) http.Handler {
+	s := NewSigner(opts...)
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			buf := newBufferedResponseWriter()
+			h.ServeHTTP(buf, r)
+
+			resp := &http.Response{
+				StatusCode: buf.statusCode,
+				Header:     buf.header,
+				Body:       io.NopCloser(bytes.NewReader(buf.body.Bytes())),
+			}
+
+			if err := s.SignResponse(resp); err != nil {
+				rw.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			body, _ := io.ReadAll(resp.Body)
+
+			for k, v := range resp.Header {
+				rw.Header()[k] = v
+			}
+			rw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+
+			rw.WriteHeader(resp.StatusCode)
+			_, _ = rw.Write(body)
+		})
+	}
+}
+
+// NewVerifyTransport returns a new client transport that wraps the provided transport with
+// http message response signature and body digest verification, the response counterpart to
+// NewSignTransport.
+//
+// Use the `WithVerify*` option funcs to configure signature verification algorithms that map
+// to their provided key ids, same as NewVerifyMiddleware. Responses with missing, malformed,
+// or invalid signatures are returned as an error instead of the response.
+func NewVerifyTransport(transport http.RoundTripper, opts ...verifyOption) http.RoundTripper {
+	v := NewVerifier(opts...)
+
+	return rt(func(r *http.Request) (*http.Response, error) {
+		resp, err := transport.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := v.VerifyResponse(resp); err != nil {
+			return nil, err
+		}
+
+		return resp, nil
+	})
+}
+
 type signOption interface {
 	configureSign(s *signer)
 }
@@ -217,7 +467,8 @@ func (o *optImpl) configureSign(s *signer)     { o.s(s) }
 func (o *optImpl) configureVerify(v *verifier) { o.v(v) }
 
 // WithHeaders sets the list of headers that will be included in the signature.
-// The Digest header is always included (and the digest calculated).
+// The Digest header, and Content-Digest unless WithContentDigest disabled it, are
+// always included (and the digests calculated).
 //
 // If not provided, the default headers `content-type, content-length, host` are used.
 func WithHeaders(hdr ...string) signOption {
@@ -227,12 +478,113 @@ func WithHeaders(hdr ...string) signOption {
 	}
 }
 
+// WithContentDigest selects which RFC 9530 Content-Digest algorithms to use, from
+// "sha-256" and "sha-512". For a Signer, a Content-Digest member is produced for each
+// alg given. For a Verifier, every member of an incoming Content-Digest header using an
+// algorithm this package can compute is checked and must match, regardless of algs; a
+// corrupted member can't hide behind an algorithm the verifier didn't ask for. algs
+// instead sets which algorithm(s) the verifier accepts as proof the digest was checked
+// at all: at least one member of the header must use one of them. Call with no
+// arguments to disable Content-Digest generation or verification entirely, eg to
+// support peers that only speak the legacy Digest header. The default, if this option
+// isn't used, is "sha-256" alone.
+func WithContentDigest(algs ...string) signOrVerifyOption {
+	return &optImpl{
+		s: func(s *signer) { s.contentDigestAlgs = algs },
+		v: func(v *verifier) { v.contentDigestAlgs = algs },
+	}
+}
+
 func WithVerifyingKeyResolver(resolver VerifyingKeyResolver) verifyOption {
 	return &optImpl{
 		v: func(v *verifier) { v.resolver = resolver },
 	}
 }
 
+// WithSigningKey adds signing using a caller-provided SigningKey using the given key id.
+// Use this to plug in algorithms this package doesn't ship, or keys backed by a KMS or
+// HSM; see SigningKeyFromCryptoSigner to adapt a stdlib crypto.Signer.
+func WithSigningKey(keyID string, key SigningKey) signOption {
+	return &optImpl{
+		s: func(s *signer) { s.keys[keyID] = bufferedSigHolder(key.Algorithm(), key) },
+	}
+}
+
+// WithVerifyingKey adds signature verification using a caller-provided VerifyingKey
+// using the given key id and alg. Use this to plug in algorithms this package doesn't
+// ship, or keys backed by a KMS or HSM.
+func WithVerifyingKey(keyID string, key VerifyingKey, alg string) verifyOption {
+	return &optImpl{
+		v: func(v *verifier) { v.keys.Store(keyID, bufferedVerHolder(alg, key)) },
+	}
+}
+
+// WithQueryParamTolerance relaxes `@path`/`@query` verification to accept signatures
+// created either with or without the request's query string. Implementations disagree
+// on whether these components should include it, which otherwise breaks interop; when a
+// signature fails to verify, the query string is stripped and the crypto-verify step is
+// retried once before giving up. Strict RFC 9421 conformance is the default.
+func WithQueryParamTolerance() verifyOption {
+	return &optImpl{
+		v: func(v *verifier) { v.queryParamTolerance = true },
+	}
+}
+
+// WithMaxSignatureAge rejects signatures whose `created` parameter is older than d.
+// Signatures without a `created` parameter are unaffected; pair with
+// WithRequiredParams("created") to require one.
+func WithMaxSignatureAge(d time.Duration) verifyOption {
+	return &optImpl{
+		v: func(v *verifier) { v.maxSignatureAge = d },
+	}
+}
+
+// WithClockSkew allows a signature's `created` parameter to be up to d in the future,
+// to tolerate clock drift between signer and verifier, before it's rejected as not yet
+// valid.
+func WithClockSkew(d time.Duration) verifyOption {
+	return &optImpl{
+		v: func(v *verifier) { v.clockSkew = d },
+	}
+}
+
+// WithRequiredParams rejects signatures missing any of the named signature parameters
+// (eg "created", "expires", "nonce").
+func WithRequiredParams(params ...string) verifyOption {
+	return &optImpl{
+		v: func(v *verifier) { v.requiredParams = params },
+	}
+}
+
+// WithRequireAllSignatures requires every signature present on a message to verify,
+// rather than the default of succeeding as soon as one does. Use this when a message is
+// expected to carry stacked signatures (eg from both a gateway and an origin) that must
+// all hold; pair with WithRequiredKeyIDs to additionally pin which key ids must be
+// present.
+func WithRequireAllSignatures() verifyOption {
+	return &optImpl{
+		v: func(v *verifier) { v.requireAllSignatures = true },
+	}
+}
+
+// WithRequiredKeyIDs demands that a signature under each of the given key ids be among
+// the ones that verify, in addition to whatever the default (any one signature) or
+// WithRequireAllSignatures policy already requires. Useful when a gateway and an origin
+// both need to have signed a request.
+func WithRequiredKeyIDs(ids ...string) verifyOption {
+	return &optImpl{
+		v: func(v *verifier) { v.requiredKeyIDs = ids },
+	}
+}
+
+// WithNonceStore replaces the default in-memory NonceStore used to reject replayed
+// signature nonces.
+func WithNonceStore(store NonceStore) verifyOption {
+	return &optImpl{
+		v: func(v *verifier) { v.nonceStore = store },
+	}
+}
+
 // WithSignRsaPssSha512 adds signing using `rsa-pss-sha512` with the given private key
 // using the given key id.
 func WithSignRsaPssSha512(keyID string, pk *rsa.PrivateKey) signOption {
@@ -273,3 +625,59 @@ func WithHmacSha256(keyID string, secret []byte) signOrVerifyOption {
 		v: func(v *verifier) { v.keys.Store(keyID, verifyHmacSha256(secret)) },
 	}
 }
+
+// WithSignEd25519 adds signing using `ed25519` with the given private key
+// using the given key id.
+func WithSignEd25519(keyID string, pk ed25519.PrivateKey) signOption {
+	return &optImpl{
+		s: func(s *signer) { s.keys[keyID] = signEd25519(pk) },
+	}
+}
+
+// WithVerifyEd25519 adds signature verification using `ed25519` with the
+// given public key using the given key id.
+func WithVerifyEd25519(keyID string, pk ed25519.PublicKey) verifyOption {
+	return &optImpl{
+		v: func(v *verifier) { v.keys.Store(keyID, verifyEd25519(pk)) },
+	}
+}
+
+// WithSignEd25519ph adds signing using `ed25519ph-sha512` (RFC 8032's
+// pre-hashed Ed25519 variant, hashed with SHA-512) with the given private
+// key using the given key id.
+func WithSignEd25519ph(keyID string, pk ed25519.PrivateKey) signOption {
+	return &optImpl{
+		s: func(s *signer) { s.keys[keyID] = signEd25519ph(pk) },
+	}
+}
+
+// WithVerifyEd25519ph adds signature verification using `ed25519ph-sha512`
+// with the given public key using the given key id.
+func WithVerifyEd25519ph(keyID string, pk ed25519.PublicKey) verifyOption {
+	return &optImpl{
+		v: func(v *verifier) { v.keys.Store(keyID, verifyEd25519ph(pk)) },
+	}
+}
+
+// WithSignCreated includes a `created` signature parameter set to the time of signing.
+func WithSignCreated() signOption {
+	return &optImpl{
+		s: func(s *signer) { s.signCreated = true },
+	}
+}
+
+// WithSignExpiresIn includes an `expires` signature parameter set to d after the time
+// of signing.
+func WithSignExpiresIn(d time.Duration) signOption {
+	return &optImpl{
+		s: func(s *signer) { s.signExpiresIn = d },
+	}
+}
+
+// WithSignNonce includes a `nonce` signature parameter, generated by calling f for
+// every signature.
+func WithSignNonce(f func() string) signOption {
+	return &optImpl{
+		s: func(s *signer) { s.nonceFunc = f },
+	}
+}
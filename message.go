@@ -0,0 +1,137 @@
+// Copyright (c) 2021 James Bowes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpsig
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// message is the transport-agnostic view of an HTTP exchange that the
+// signer and verifier canonicalize and sign or verify. Method, URL and
+// Authority are only meaningful for a request; Status is only meaningful
+// for a response. isResponse records which, so canonicalize can reject
+// components that don't apply.
+type message struct {
+	Method    string
+	URL       *url.URL
+	Authority string
+	Status    int
+	Header    http.Header
+
+	isResponse bool
+}
+
+func messageFromRequest(r *http.Request) *message {
+	return &message{
+		Method:    r.Method,
+		URL:       r.URL,
+		Authority: r.Host,
+		Header:    r.Header,
+	}
+}
+
+func messageFromResponse(resp *http.Response) *message {
+	return &message{
+		Status:     resp.StatusCode,
+		Header:     resp.Header,
+		isResponse: true,
+	}
+}
+
+// canonicalizeMethod writes the `@method` derived component, section 2.2.1.
+func canonicalizeMethod(b *bytes.Buffer, method string) error {
+	fmt.Fprintf(b, "\"@method\": %s\n", strings.ToUpper(method))
+	return nil
+}
+
+// canonicalizePath writes the `@path` derived component, section 2.2.3.
+func canonicalizePath(b *bytes.Buffer, path string) error {
+	if path == "" {
+		path = "/"
+	}
+
+	fmt.Fprintf(b, "\"@path\": %s\n", path)
+	return nil
+}
+
+// canonicalizeQuery writes the `@query` derived component, section 2.2.4.
+func canonicalizeQuery(b *bytes.Buffer, query string) error {
+	fmt.Fprintf(b, "\"@query\": ?%s\n", query)
+	return nil
+}
+
+// canonicalizeAuthority writes the `@authority` derived component, section 2.2.2.
+func canonicalizeAuthority(b *bytes.Buffer, authority string) error {
+	fmt.Fprintf(b, "\"@authority\": %s\n", strings.ToLower(authority))
+	return nil
+}
+
+// canonicalizeStatus writes the `@status` derived component, section 2.2.9.
+// It only applies to responses.
+func canonicalizeStatus(b *bytes.Buffer, status int) error {
+	fmt.Fprintf(b, "\"@status\": %d\n", status)
+	return nil
+}
+
+// canonicalizeHeader writes a regular (header-backed) component, section 2.1.
+func canonicalizeHeader(b *bytes.Buffer, name string, header http.Header) error {
+	name = strings.ToLower(name)
+
+	vals := header.Values(name)
+	if len(vals) == 0 {
+		return fmt.Errorf("httpsig: missing header %q", name)
+	}
+
+	trimmed := make([]string, len(vals))
+	for i, v := range vals {
+		trimmed[i] = strings.TrimSpace(v)
+	}
+
+	fmt.Fprintf(b, "\"%s\": %s\n", name, strings.Join(trimmed, ", "))
+	return nil
+}
+
+// canonicalize writes the canonicalized form of the given components, in
+// order, to b, per RFC 9421 section 2.3.
+func canonicalize(b *bytes.Buffer, msg *message, items []string) error {
+	for _, h := range items {
+		var err error
+		switch h {
+		case "@method", "@path", "@query", "@authority":
+			if msg.isResponse {
+				return fmt.Errorf("httpsig: component %q is not valid for a response", h)
+			}
+		case "@status":
+			if !msg.isResponse {
+				return fmt.Errorf("httpsig: component %q is not valid for a request", h)
+			}
+		}
+
+		switch h {
+		case "@method":
+			err = canonicalizeMethod(b, msg.Method)
+		case "@path":
+			err = canonicalizePath(b, msg.URL.Path)
+		case "@query":
+			err = canonicalizeQuery(b, msg.URL.RawQuery)
+		case "@authority":
+			err = canonicalizeAuthority(b, msg.Authority)
+		case "@status":
+			err = canonicalizeStatus(b, msg.Status)
+		default:
+			err = canonicalizeHeader(b, h, msg.Header)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
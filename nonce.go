@@ -0,0 +1,58 @@
+// Copyright (c) 2021 James Bowes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpsig
+
+import (
+	"sync"
+	"time"
+)
+
+// NonceStore tracks (keyID, nonce) pairs already seen in a verified
+// signature, so replayed signatures can be rejected. Seen reports whether
+// the pair was already recorded, recording it as a side effect of the call
+// when it wasn't.
+type NonceStore interface {
+	Seen(keyID, nonce string) bool
+}
+
+// memNonceStore is the default NonceStore: an in-memory cache that evicts
+// entries older than ttl so memory use stays bounded.
+type memNonceStore struct {
+	mu   sync.Mutex
+	ttl  time.Duration
+	seen map[string]time.Time
+
+	// For testing
+	nowFunc func() time.Time
+}
+
+func newMemNonceStore(ttl time.Duration) *memNonceStore {
+	return &memNonceStore{
+		ttl:     ttl,
+		seen:    make(map[string]time.Time),
+		nowFunc: time.Now,
+	}
+}
+
+func (s *memNonceStore) Seen(keyID, nonce string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.nowFunc()
+
+	for k, t := range s.seen {
+		if now.Sub(t) > s.ttl {
+			delete(s.seen, k)
+		}
+	}
+
+	key := keyID + "\x00" + nonce
+	if _, ok := s.seen[key]; ok {
+		return true
+	}
+
+	s.seen[key] = now
+	return false
+}
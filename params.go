@@ -0,0 +1,123 @@
+// Copyright (c) 2021 James Bowes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpsig
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// signatureParams holds the parsed (or to-be-serialized) contents of a
+// single member of the Signature-Input header, RFC 9421 section 2.3.
+type signatureParams struct {
+	items   []string
+	keyID   string
+	alg     string
+	created *time.Time
+	expires *time.Time
+	nonce   string
+}
+
+// parseSignatureInput parses a single Signature-Input member value, eg
+// `("@method" "@path");keyid="test-key";alg="rsa-pss-sha512"`.
+func parseSignatureInput(raw string) (*signatureParams, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.HasPrefix(raw, "(") {
+		return nil, errMalformedSignature
+	}
+
+	end := strings.Index(raw, ")")
+	if end < 0 {
+		return nil, errMalformedSignature
+	}
+
+	params := &signatureParams{}
+
+	if inner := strings.TrimSpace(raw[1:end]); inner != "" {
+		for _, item := range strings.Fields(inner) {
+			params.items = append(params.items, strings.Trim(item, `"`))
+		}
+	}
+
+	for _, kv := range strings.Split(raw[end+1:], ";") {
+		kv = strings.TrimPrefix(kv, ";")
+		if kv == "" {
+			continue
+		}
+
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return nil, errMalformedSignature
+		}
+
+		key, val := parts[0], strings.Trim(parts[1], `"`)
+
+		var err error
+		switch key {
+		case "keyid":
+			params.keyID = val
+		case "alg":
+			params.alg = val
+		case "nonce":
+			params.nonce = val
+		case "created":
+			params.created, err = parseUnixParam(val)
+		case "expires":
+			params.expires, err = parseUnixParam(val)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if params.keyID == "" {
+		return nil, errMalformedSignature
+	}
+
+	return params, nil
+}
+
+func parseUnixParam(val string) (*time.Time, error) {
+	sec, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return nil, errMalformedSignature
+	}
+
+	t := time.Unix(sec, 0)
+	return &t, nil
+}
+
+// serialize renders the signature params back into Signature-Input member
+// syntax, in the same component order they were canonicalized in.
+func (p *signatureParams) serialize() string {
+	items := make([]string, len(p.items))
+	for i, it := range p.items {
+		items[i] = fmt.Sprintf("%q", it)
+	}
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "(%s)", strings.Join(items, " "))
+
+	if p.created != nil {
+		fmt.Fprintf(b, ";created=%d", p.created.Unix())
+	}
+	if p.expires != nil {
+		fmt.Fprintf(b, ";expires=%d", p.expires.Unix())
+	}
+	if p.nonce != "" {
+		fmt.Fprintf(b, ";nonce=%q", p.nonce)
+	}
+
+	fmt.Fprintf(b, ";keyid=%q", p.keyID)
+
+	if p.alg != "" {
+		fmt.Fprintf(b, ";alg=%q", p.alg)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2021 James Bowes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sigImpl is the per-signature signing machinery for one algorithm. w is
+// written the canonicalized message; sum then extracts what sign needs to
+// produce a signature over, either a hash digest (the streaming-hash model
+// used by rsa-pss-sha512, ecdsa-p256-sha256 and hmac-sha256) or the raw
+// buffered message (the model ed25519 requires, since it signs the full
+// message rather than a pre-hash).
+type sigImpl struct {
+	w    io.Writer
+	sum  func() []byte
+	sign func(content []byte) ([]byte, error)
+}
+
+type sigHolder struct {
+	alg    string
+	signer func() sigImpl
+}
+
+type signer struct {
+	keys    map[string]sigHolder
+	headers []string
+
+	signCreated   bool
+	signExpiresIn time.Duration
+	nonceFunc     func() string
+
+	contentDigestAlgs []string
+
+	// For testing
+	nowFunc func() time.Time
+}
+
+// Sign canonicalizes msg per s.headers and produces the Signature and
+// Signature-Input header values for every configured key.
+func (s *signer) Sign(msg *message) (http.Header, error) {
+	return s.signItems(msg, s.headers)
+}
+
+// signItems is like Sign, but canonicalizes the given components instead
+// of s.headers. It's used to sign responses, whose specialty components
+// (`@status`) differ from a request's (`@method`, `@path`, `@query`).
+func (s *signer) signItems(msg *message, items []string) (http.Header, error) {
+	keyIDs := make([]string, 0, len(s.keys))
+	for keyID := range s.keys {
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Strings(keyIDs)
+
+	var sigs []string
+	var params []string
+
+	for i, keyID := range keyIDs {
+		holder := s.keys[keyID]
+		sigID := fmt.Sprintf("sig%d", i+1)
+
+		p := &signatureParams{items: items, keyID: keyID, alg: holder.alg}
+
+		if s.signCreated || s.signExpiresIn > 0 {
+			now := s.nowFunc()
+			if s.signCreated {
+				p.created = &now
+			}
+			if s.signExpiresIn > 0 {
+				expires := now.Add(s.signExpiresIn)
+				p.expires = &expires
+			}
+		}
+		if s.nonceFunc != nil {
+			p.nonce = s.nonceFunc()
+		}
+
+		paramsRaw := p.serialize()
+
+		var b bytes.Buffer
+		if err := canonicalize(&b, msg, items); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "\"@signature-params\": %s", paramsRaw)
+
+		impl := holder.signer()
+		if _, err := impl.w.Write(b.Bytes()); err != nil {
+			return nil, err
+		}
+
+		sig, err := impl.sign(impl.sum())
+		if err != nil {
+			return nil, err
+		}
+
+		sigs = append(sigs, fmt.Sprintf("%s=:%s:", sigID, base64.StdEncoding.EncodeToString(sig)))
+		params = append(params, fmt.Sprintf("%s=%s", sigID, paramsRaw))
+	}
+
+	hdr := http.Header{}
+	hdr.Set("Signature", strings.Join(sigs, ", "))
+	hdr.Set("Signature-Input", strings.Join(params, ", "))
+
+	return hdr, nil
+}
+
+// bufferedSigHolder wraps a SigningKey into a sigHolder that buffers the full
+// canonicalized message before delegating to key's own signing logic, the same model
+// ed25519 uses below.
+func bufferedSigHolder(alg string, key SigningKey) sigHolder {
+	return sigHolder{
+		alg: alg,
+		signer: func() sigImpl {
+			var buf bytes.Buffer
+
+			return sigImpl{
+				w:   &buf,
+				sum: buf.Bytes,
+				sign: func(content []byte) ([]byte, error) {
+					return key.Sign(content)
+				},
+			}
+		},
+	}
+}
+
+func signRsaPssSha512(pk *rsa.PrivateKey) sigHolder {
+	return sigHolder{
+		alg: "rsa-pss-sha512",
+		signer: func() sigImpl {
+			h := sha512.New()
+
+			return sigImpl{
+				w:   h,
+				sum: func() []byte { return h.Sum(nil) },
+				sign: func(content []byte) ([]byte, error) {
+					return rsa.SignPSS(rand.Reader, pk, crypto.SHA512, content, nil)
+				},
+			}
+		},
+	}
+}
+
+func signEccP256(pk *ecdsa.PrivateKey) sigHolder {
+	return sigHolder{
+		alg: "ecdsa-p256-sha256",
+		signer: func() sigImpl {
+			h := sha256.New()
+
+			return sigImpl{
+				w:   h,
+				sum: func() []byte { return h.Sum(nil) },
+				sign: func(content []byte) ([]byte, error) {
+					return ecdsa.SignASN1(rand.Reader, pk, content)
+				},
+			}
+		},
+	}
+}
+
+func signHmacSha256(secret []byte) sigHolder {
+	return sigHolder{
+		alg: "hmac-sha256",
+		signer: func() sigImpl {
+			h := hmac.New(sha256.New, secret)
+
+			return sigImpl{
+				w:   h,
+				sum: func() []byte { return h.Sum(nil) },
+				sign: func(content []byte) ([]byte, error) {
+					return content, nil
+				},
+			}
+		},
+	}
+}
+
+// signEd25519 signs using `ed25519`. Unlike the streaming-hash algorithms
+// above, Ed25519 signs the full message rather than a pre-hash, so sum
+// returns the raw buffered bytes instead of a digest.
+func signEd25519(pk ed25519.PrivateKey) sigHolder {
+	return sigHolder{
+		alg: "ed25519",
+		signer: func() sigImpl {
+			var buf bytes.Buffer
+
+			return sigImpl{
+				w:   &buf,
+				sum: buf.Bytes,
+				sign: func(content []byte) ([]byte, error) {
+					return ed25519.Sign(pk, content), nil
+				},
+			}
+		},
+	}
+}
+
+// signEd25519ph signs using `ed25519ph-sha512`, the pre-hashed Ed25519
+// variant from RFC 8032, with SHA-512 as the pre-hash. Unlike plain
+// ed25519, ed25519ph requires its input to already be the 64-byte SHA-512
+// digest of the message, so sum hashes the buffered bytes rather than
+// returning them raw.
+func signEd25519ph(pk ed25519.PrivateKey) sigHolder {
+	return sigHolder{
+		alg: "ed25519ph-sha512",
+		signer: func() sigImpl {
+			var buf bytes.Buffer
+
+			return sigImpl{
+				w:   &buf,
+				sum: func() []byte { sum := sha512.Sum512(buf.Bytes()); return sum[:] },
+				sign: func(content []byte) ([]byte, error) {
+					return pk.Sign(rand.Reader, content, &ed25519.Options{Hash: crypto.SHA512})
+				},
+			}
+		},
+	}
+}
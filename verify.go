@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/hmac"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -21,9 +22,16 @@ import (
 	"time"
 )
 
+// verImpl is the per-signature verification machinery for one algorithm. w
+// is written the canonicalized message; sum then extracts what verify needs
+// to check the signature against, either a hash digest (the streaming-hash
+// model used by rsa-pss-sha512, ecdsa-p256-sha256 and hmac-sha256) or the
+// raw buffered message (the model ed25519 requires, since it verifies
+// against the full message rather than a pre-hash).
 type verImpl struct {
 	w      io.Writer
-	verify func([]byte) error
+	sum    func() []byte
+	verify func(content, sig []byte) error
 }
 
 type verHolder struct {
@@ -35,11 +43,46 @@ type verifier struct {
 	keys     sync.Map // map[string]verHolder
 	resolver VerifyingKeyResolver
 
+	queryParamTolerance bool
+
+	maxSignatureAge time.Duration
+	clockSkew       time.Duration
+	requiredParams  []string
+	nonceStore      NonceStore
+
+	requireAllSignatures bool
+	requiredKeyIDs       []string
+
+	contentDigestAlgs []string
+
 	// For testing
 	nowFunc func() time.Time
 }
 
-// XXX: note about fail fast.
+// allKeyIDsVerified reports whether every id in required has verified.
+func allKeyIDsVerified(verified map[string]bool, required []string) bool {
+	for _, id := range required {
+		if !verified[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// sigCandidate is one `Signature`/`Signature-Input` pair whose keyID resolves to a
+// known key, ready for Verify to attempt.
+type sigCandidate struct {
+	sigID     string
+	params    *signatureParams
+	paramsRaw string
+}
+
+// Verify checks msg's Signature and Signature-Input headers. By default it succeeds as
+// soon as any signature with a resolvable key id verifies, so that a request carrying
+// signatures under multiple key ids (eg during key rotation, or stacked gateway and
+// origin signatures) only needs one of them to hold. Use WithRequireAllSignatures to
+// demand that every signature verify, and WithRequiredKeyIDs to demand that specific key
+// ids be among the ones that do.
 func (v *verifier) Verify(msg *message) (keyID string, err error) {
 	sigHdr := msg.Header.Get("Signature")
 	if sigHdr == "" {
@@ -58,42 +101,109 @@ func (v *verifier) Verify(msg *message) (keyID string, err error) {
 		return "", errMalformedSignature
 	}
 
-	// TODO: could be smarter about selecting the sig to verify, eg based
-	// on algorithm
-	var sigID string
-	var params *signatureParams
-	var paramsRaw string
+	var candidates []sigCandidate
+	sawUnknownKey := false
 	for _, p := range paramParts {
 		pParts := strings.SplitN(p, "=", 2)
 		if len(pParts) != 2 {
 			return "", errMalformedSignature
 		}
 
-		candidate, err := parseSignatureInput(pParts[1])
+		params, err := parseSignatureInput(pParts[1])
 		if err != nil {
 			return "", errMalformedSignature
 		}
 
-		if _, ok := v.ResolveKey(candidate.keyID); ok {
-			sigID = pParts[0]
-			params = candidate
-			paramsRaw = pParts[1]
-			break
+		if _, ok := v.ResolveKey(params.keyID); ok {
+			candidates = append(candidates, sigCandidate{sigID: pParts[0], params: params, paramsRaw: pParts[1]})
+		} else {
+			sawUnknownKey = true
 		}
 	}
 
-	if params == nil {
+	if len(candidates) == 0 {
 		return "", errUnknownKey
 	}
 
+	verified := make(map[string]bool, len(candidates))
+	var firstVerified string
+	var errs []error
+	for _, c := range candidates {
+		if err := v.verifyOne(msg, sigParts, c); err != nil {
+			errs = append(errs, fmt.Errorf("key %q: %w", c.params.keyID, err))
+			continue
+		}
+
+		verified[c.params.keyID] = true
+		if firstVerified == "" {
+			firstVerified = c.params.keyID
+		}
+
+		// Unless every signature must verify, with no required key ids any one
+		// verified signature is enough to stop early. With required key ids, keep going until all of them have
+		// verified (or candidates run out), since the first signature to verify
+		// may not be one of the required ones.
+		if !v.requireAllSignatures && len(v.requiredKeyIDs) == 0 {
+			break
+		}
+
+		if !v.requireAllSignatures && allKeyIDsVerified(verified, v.requiredKeyIDs) {
+			break
+		}
+	}
+
+	ok := len(verified) > 0
+	if v.requireAllSignatures {
+		ok = ok && len(verified) == len(candidates) && !sawUnknownKey
+		if sawUnknownKey {
+			errs = append(errs, errUnknownKey)
+		}
+	}
+
+	for _, req := range v.requiredKeyIDs {
+		if !verified[req] {
+			ok = false
+			errs = append(errs, fmt.Errorf("required key id %q did not verify", req))
+		}
+	}
+
+	if !ok {
+		return firstVerified, errors.Join(errs...)
+	}
+
+	return firstVerified, nil
+}
+
+// verifyOne attempts to verify c against msg, checking c's required signature
+// parameters, cryptographic signature, and expiry/freshness/nonce, in that order.
+func (v *verifier) verifyOne(msg *message, sigParts []string, c sigCandidate) error {
+	params := c.params
+
+	for _, req := range v.requiredParams {
+		switch req {
+		case "created":
+			if params.created == nil {
+				return errMissingParam
+			}
+		case "expires":
+			if params.expires == nil {
+				return errMissingParam
+			}
+		case "nonce":
+			if params.nonce == "" {
+				return errMissingParam
+			}
+		}
+	}
+
 	var signature string
 	for _, s := range sigParts {
 		sParts := strings.SplitN(s, "=", 2)
 		if len(sParts) != 2 {
-			return params.keyID, errMalformedSignature
+			return errMalformedSignature
 		}
 
-		if sParts[0] == sigID {
+		if sParts[0] == c.sigID {
 			// TODO: error if not surrounded by colons
 			signature = strings.Trim(sParts[1], ":")
 			break
@@ -101,67 +211,91 @@ func (v *verifier) Verify(msg *message) (keyID string, err error) {
 	}
 
 	if signature == "" {
-		return params.keyID, errMalformedSignature
+		return errMalformedSignature
 	}
 
 	ver, _ := v.ResolveKey(params.keyID)
 	if ver.alg != "" && params.alg != "" && ver.alg != params.alg {
-		return params.keyID, errAlgMismatch
+		return errAlgMismatch
 	}
 
 	// verify signature. if invalid, error
 	sig, err := base64.StdEncoding.DecodeString(signature)
 	if err != nil {
-		return params.keyID, errMalformedSignature
+		return errMalformedSignature
 	}
 
-	verifier := ver.verifier()
+	impl, err := canonicalizeFor(ver, msg, params.items, c.paramsRaw)
+	if err != nil {
+		return err
+	}
 
-	//TODO: skip the buffer.
+	verErr := impl.verify(impl.sum(), sig)
 
-	var b bytes.Buffer
+	// Fediverse implementations disagree on whether @path/@query cover the
+	// query string, which breaks interop. When enabled, retry the crypto
+	// verify (and only that step) with the query string stripped before
+	// giving up.
+	if verErr != nil && v.queryParamTolerance && msg.URL != nil && msg.URL.RawQuery != "" &&
+		(sliceHas(params.items, "@path") || sliceHas(params.items, "@query")) {
 
-	// canonicalize headers
-	// TODO: wrap the errors within
-	for _, h := range params.items {
-
-		// handle specialty components, section 2.3
-		var err error
-		switch h {
-		case "@method":
-			err = canonicalizeMethod(&b, msg.Method)
-		case "@path":
-			err = canonicalizePath(&b, msg.URL.Path)
-		case "@query":
-			err = canonicalizeQuery(&b, msg.URL.RawQuery)
-		case "@authority":
-			err = canonicalizeAuthority(&b, msg.Authority)
-		default:
-			// handle default (header) components
-			err = canonicalizeHeader(&b, h, msg.Header)
+		stripped := *msg
+		strippedURL := *msg.URL
+		strippedURL.RawQuery = ""
+		stripped.URL = &strippedURL
+
+		if altImpl, err := canonicalizeFor(ver, &stripped, params.items, c.paramsRaw); err == nil {
+			if altImpl.verify(altImpl.sum(), sig) == nil {
+				verErr = nil
+			}
 		}
+	}
 
-		if err != nil {
-			return params.keyID, err
+	if verErr != nil {
+		return errInvalidSignature
+	}
+
+	now := v.nowFunc()
+
+	if params.expires != nil && !params.expires.After(now) {
+		return errSignatureExpired
+	}
+
+	if params.created != nil {
+		if v.maxSignatureAge > 0 && now.Sub(*params.created) > v.maxSignatureAge {
+			return errSignatureTooOld
+		}
+
+		if params.created.After(now.Add(v.clockSkew)) {
+			return errSignatureNotYetValid
 		}
 	}
-	fmt.Fprintf(&b, "\"@signature-params\": %s", paramsRaw)
 
-	if _, err := verifier.w.Write(b.Bytes()); err != nil {
-		return params.keyID, err
+	if params.nonce != "" && v.nonceStore != nil && v.nonceStore.Seen(params.keyID, params.nonce) {
+		return errReplayedNonce
 	}
 
-	err = verifier.verify(sig)
-	if err != nil {
-		return params.keyID, errInvalidSignature
+	return nil
+}
+
+// canonicalizeFor builds ver's verImpl and writes msg's canonicalized
+// components (plus the signature params line) to it, ready for verify.
+func canonicalizeFor(ver verHolder, msg *message, items []string, paramsRaw string) (verImpl, error) {
+	impl := ver.verifier()
+
+	//TODO: skip the buffer.
+
+	var b bytes.Buffer
+	if err := canonicalize(&b, msg, items); err != nil {
+		return verImpl{}, err
 	}
+	fmt.Fprintf(&b, "\"@signature-params\": %s", paramsRaw)
 
-	// TODO: could put in some wiggle room
-	if params.expires != nil && params.expires.After(time.Now()) {
-		return params.keyID, errSignatureExpired
+	if _, err := impl.w.Write(b.Bytes()); err != nil {
+		return verImpl{}, err
 	}
 
-	return params.keyID, nil
+	return impl, nil
 }
 
 func (v *verifier) ResolveKey(keyID string) (verHolder, bool) {
@@ -176,9 +310,10 @@ func (v *verifier) ResolveKey(keyID string) (verHolder, bool) {
 				verifier: func() verImpl {
 					in := bytes.NewBuffer(make([]byte, 0, 1024))
 					return verImpl{
-						w: in,
-						verify: func(sig []byte) error {
-							return key.Verify(in.Bytes(), sig)
+						w:   in,
+						sum: in.Bytes,
+						verify: func(content, sig []byte) error {
+							return key.Verify(content, sig)
 						},
 					}
 				},
@@ -194,12 +329,16 @@ func (v *verifier) ResolveKey(keyID string) (verHolder, bool) {
 // XXX use vice here too.
 
 var (
-	errNotSigned          = errors.New("signature headers not found")
-	errMalformedSignature = errors.New("unable to parse signature headers")
-	errUnknownKey         = errors.New("unknown key id")
-	errAlgMismatch        = errors.New("algorithm mismatch for key id")
-	errSignatureExpired   = errors.New("signature expired")
-	errInvalidSignature   = errors.New("invalid signature")
+	errNotSigned            = errors.New("signature headers not found")
+	errMalformedSignature   = errors.New("unable to parse signature headers")
+	errUnknownKey           = errors.New("unknown key id")
+	errAlgMismatch          = errors.New("algorithm mismatch for key id")
+	errSignatureExpired     = errors.New("signature expired")
+	errInvalidSignature     = errors.New("invalid signature")
+	errMissingParam         = errors.New("required signature parameter missing")
+	errSignatureTooOld      = errors.New("signature created too long ago")
+	errSignatureNotYetValid = errors.New("signature created too far in the future")
+	errReplayedNonce        = errors.New("signature nonce already used")
 )
 
 // These error checking funcs aren't needed yet, so don't export them
@@ -222,11 +361,10 @@ func verifyRsaPssSha512(pk *rsa.PublicKey) verHolder {
 			h := sha512.New()
 
 			return verImpl{
-				w: h,
-				verify: func(s []byte) error {
-					b := h.Sum(nil)
-
-					return rsa.VerifyPSS(pk, crypto.SHA512, b, s, nil)
+				w:   h,
+				sum: func() []byte { return h.Sum(nil) },
+				verify: func(content, sig []byte) error {
+					return rsa.VerifyPSS(pk, crypto.SHA512, content, sig, nil)
 				},
 			}
 		},
@@ -240,11 +378,10 @@ func verifyEccP256(pk *ecdsa.PublicKey) verHolder {
 			h := sha256.New()
 
 			return verImpl{
-				w: h,
-				verify: func(s []byte) error {
-					b := h.Sum(nil)
-
-					if !ecdsa.VerifyASN1(pk, b, s) {
+				w:   h,
+				sum: func() []byte { return h.Sum(nil) },
+				verify: func(content, sig []byte) error {
+					if !ecdsa.VerifyASN1(pk, content, sig) {
 						return errInvalidSignature
 					}
 
@@ -262,9 +399,10 @@ func verifyHmacSha256(secret []byte) verHolder {
 			h := hmac.New(sha256.New, secret)
 
 			return verImpl{
-				w: h,
-				verify: func(in []byte) error {
-					if !hmac.Equal(in, h.Sum(nil)) {
+				w:   h,
+				sum: func() []byte { return h.Sum(nil) },
+				verify: func(content, sig []byte) error {
+					if !hmac.Equal(sig, content) {
 						return errInvalidSignature
 					}
 					return nil
@@ -273,3 +411,68 @@ func verifyHmacSha256(secret []byte) verHolder {
 		},
 	}
 }
+
+// verifyEd25519 verifies using `ed25519`. Unlike the streaming-hash
+// algorithms above, Ed25519 verifies against the full message rather than
+// a pre-hash, so sum returns the raw buffered bytes instead of a digest.
+func verifyEd25519(pk ed25519.PublicKey) verHolder {
+	return verHolder{
+		alg: "ed25519",
+		verifier: func() verImpl {
+			var buf bytes.Buffer
+
+			return verImpl{
+				w:   &buf,
+				sum: buf.Bytes,
+				verify: func(content, sig []byte) error {
+					if !ed25519.Verify(pk, content, sig) {
+						return errInvalidSignature
+					}
+					return nil
+				},
+			}
+		},
+	}
+}
+
+// bufferedVerHolder wraps a VerifyingKey into a verHolder that buffers the full
+// canonicalized message before delegating to key's own verification logic, the same
+// model ed25519 uses above.
+func bufferedVerHolder(alg string, key VerifyingKey) verHolder {
+	return verHolder{
+		alg: alg,
+		verifier: func() verImpl {
+			var buf bytes.Buffer
+
+			return verImpl{
+				w:   &buf,
+				sum: buf.Bytes,
+				verify: func(content, sig []byte) error {
+					return key.Verify(content, sig)
+				},
+			}
+		},
+	}
+}
+
+// verifyEd25519ph verifies using `ed25519ph-sha512`, the pre-hashed
+// Ed25519 variant from RFC 8032, with SHA-512 as the pre-hash. Unlike plain
+// ed25519, ed25519ph requires its input to already be the 64-byte SHA-512
+// digest of the message, so sum hashes the buffered bytes rather than
+// returning them raw.
+func verifyEd25519ph(pk ed25519.PublicKey) verHolder {
+	return verHolder{
+		alg: "ed25519ph-sha512",
+		verifier: func() verImpl {
+			var buf bytes.Buffer
+
+			return verImpl{
+				w:   &buf,
+				sum: func() []byte { sum := sha512.Sum512(buf.Bytes()); return sum[:] },
+				verify: func(content, sig []byte) error {
+					return ed25519.VerifyWithOptions(pk, content, sig, &ed25519.Options{Hash: crypto.SHA512})
+				},
+			}
+		},
+	}
+}
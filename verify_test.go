@@ -0,0 +1,52 @@
+// Copyright (c) 2021 James Bowes. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpsig
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// signAs signs req using s, relabeling the resulting Signature/Signature-Input
+// identifier to label so multiple independently produced signatures can be
+// merged onto one request.
+func signAs(t *testing.T, req *http.Request, s *Signer, label string) (sig, sigInput string) {
+	t.Helper()
+
+	if err := s.Sign(req); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	rewind(t, &req.Body)
+
+	return strings.Replace(req.Header.Get("Signature"), "sig1", label, 1),
+		strings.Replace(req.Header.Get("Signature-Input"), "sig1", label, 1)
+}
+
+func TestVerifyRequiredKeyIDsWithoutRequireAll(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/foo", nil)
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Content-Length", "0")
+
+	gwSig, gwSigInput := signAs(t, req, NewSigner(WithHmacSha256("gateway", []byte("gw-secret"))), "gwsig")
+	originSig, originSigInput := signAs(t, req, NewSigner(WithHmacSha256("origin", []byte("origin-secret"))), "originsig")
+
+	req.Header.Set("Signature", gwSig+", "+originSig)
+	req.Header.Set("Signature-Input", gwSigInput+", "+originSigInput)
+
+	v := NewVerifier(
+		WithHmacSha256("gateway", []byte("gw-secret")),
+		WithHmacSha256("origin", []byte("origin-secret")),
+		WithRequiredKeyIDs("gateway", "origin"),
+	)
+
+	// Without WithRequireAllSignatures, the verify loop must still keep trying
+	// candidates until every required key id has had a chance, not stop as
+	// soon as the first (eg "gateway") happens to verify.
+	if _, err := v.Verify(req); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+}